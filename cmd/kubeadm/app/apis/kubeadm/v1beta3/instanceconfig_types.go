@@ -0,0 +1,41 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta3
+
+// NodeInstanceConfig is a kubeadm-owned, node-local record of this node's identity and registration
+// options. It is written at "kubeadm init"/"join" time next to the kubelet configuration, and lets kubeadm
+// resolve a node's name (and, where available, its CRI socket and kubelet extra args) without depending on
+// parsing the kubelet client certificate, which is fragile around certificate rotation and the Node object
+// not always being reachable (e.g. during air-gapped recovery).
+//
+// Unlike ClusterConfiguration/JoinConfiguration, NodeInstanceConfig is not a versioned API type: it is
+// never registered in a scheme, converted, defaulted or validated through the standard codecs, and has no
+// TypeMeta/Kind of its own -- it is a plain internal record that happens to live in this package next to the
+// types it borrows fields from.
+type NodeInstanceConfig struct {
+	// NodeName is the resolved name of this node.
+	NodeName string `json:"nodeName"`
+
+	// CRISocket is the CRI socket this node was registered with.
+	// +optional
+	CRISocket string `json:"criSocket,omitempty"`
+
+	// KubeletExtraArgs are the extra flags passed to the kubelet on this node, as of the last time kubeadm
+	// wrote this file.
+	// +optional
+	KubeletExtraArgs map[string]string `json:"kubeletExtraArgs,omitempty"`
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	initphase "k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/init"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+)
+
+// newInitPhaseRunner creates the workflow.Runner that "kubeadm init" executes, wiring every init phase into
+// the order it must run in. kubelet-finalize runs once kubelet-start has brought the kubelet up, so that the
+// kubelet-extra-args annotation and the node instance config are written from the very first boot.
+func newInitPhaseRunner() *workflow.Runner {
+	runner := workflow.NewRunner()
+	runner.AppendPhase(initphase.NewPreflightPhase())
+	runner.AppendPhase(initphase.NewCertsPhase())
+	runner.AppendPhase(initphase.NewKubeConfigPhase())
+	runner.AppendPhase(initphase.NewKubeletStartPhase())
+	runner.AppendPhase(initphase.NewControlPlanePhase())
+	runner.AppendPhase(initphase.NewEtcdPhase())
+	runner.AppendPhase(initphase.NewWaitControlPlanePhase())
+	runner.AppendPhase(initphase.NewUploadConfigPhase())
+	runner.AppendPhase(initphase.NewUploadCertsPhase())
+	runner.AppendPhase(initphase.NewMarkControlPlanePhase())
+	runner.AppendPhase(initphase.NewBootstrapTokenPhase())
+	runner.AppendPhase(initphase.NewKubeletFinalizePhase())
+	runner.AppendPhase(initphase.NewAddonPhase())
+	runner.AppendPhase(initphase.NewShowJoinCommandPhase())
+	return runner
+}
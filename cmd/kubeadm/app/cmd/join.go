@@ -0,0 +1,37 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	joinphase "k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/join"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+)
+
+// newJoinPhaseRunner creates the workflow.Runner that "kubeadm join" executes, wiring every join phase into
+// the order it must run in. kubelet-finalize runs once kubelet-start has brought the kubelet up, so that the
+// kubelet-extra-args annotation and the node instance config are written from the very first boot, the same
+// as on a node created with "kubeadm init".
+func newJoinPhaseRunner() *workflow.Runner {
+	runner := workflow.NewRunner()
+	runner.AppendPhase(joinphase.NewPreflightPhase())
+	runner.AppendPhase(joinphase.NewControlPlanePrepareJoinPhase())
+	runner.AppendPhase(joinphase.NewCheckEtcdPhase())
+	runner.AppendPhase(joinphase.NewKubeletStartPhase())
+	runner.AppendPhase(joinphase.NewControlPlaneJoinPhase())
+	runner.AppendPhase(joinphase.NewKubeletFinalizePhase())
+	return runner
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phases
+
+import (
+	"github.com/pkg/errors"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/options"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+	kubeletphase "k8s.io/kubernetes/cmd/kubeadm/app/phases/kubelet"
+)
+
+// NewKubeletFinalizePhase creates a kubeadm workflow phase that finalizes per-node kubelet bookkeeping once
+// the kubelet has been started and this node has joined the cluster: the kubelet-extra-args annotation and
+// the node instance config are written so that they exist from first boot.
+func NewKubeletFinalizePhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  "kubelet-finalize",
+		Short: "Update settings relevant to the node registration once the kubelet is running",
+		Run:   runKubeletFinalizePhase,
+		InheritFlags: []string{
+			options.KubeconfigPath,
+		},
+	}
+}
+
+func runKubeletFinalizePhase(c workflow.RunData) error {
+	data, ok := c.(JoinData)
+	if !ok {
+		return errors.New("kubelet-finalize phase invoked with an invalid data struct")
+	}
+
+	return kubeletphase.PersistNodeIdentity(data.Client(), &data.Cfg().NodeRegistration)
+}
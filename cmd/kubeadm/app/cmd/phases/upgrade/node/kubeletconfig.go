@@ -19,10 +19,10 @@ package node
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 
 	"k8s.io/klog/v2"
 
@@ -44,7 +44,17 @@ var (
 		Download the kubelet configuration from a ConfigMap of the form "kubelet-config-1.X" in the cluster,
 		where X is the minor version of the kubelet. kubeadm uses the KuberneteVersion field in the kubeadm-config
 		ConfigMap to determine what the _desired_ kubelet version is.
+
+		Before writing the new configuration, the previous kubelet configuration, kubeadm-flags.env and CRI-socket
+		annotation are checkpointed so that "kubeadm upgrade node phase kubelet-config --rollback" can put them
+		back if something goes wrong.
+
+		KubeletExtraArgs recorded on the Node are also reconciled against kubeadm-flags.env; pass
+		--reconcile-kubelet-flags to have divergence rewritten on disk instead of only logged.
 		`)
+
+	kubeletConfigRollback bool
+	reconcileKubeletFlags bool
 )
 
 // NewKubeletConfigPhase creates a kubeadm workflow phase that implements handling of kubelet-config upgrade.
@@ -59,6 +69,11 @@ func NewKubeletConfigPhase() workflow.Phase {
 			options.KubeconfigPath,
 		},
 	}
+	phase.LocalFlags = pflag.NewFlagSet(phase.Name, pflag.ExitOnError)
+	phase.LocalFlags.BoolVar(&kubeletConfigRollback, "rollback", false,
+		"Restore the kubelet configuration, kubeadm-flags.env and CRI-socket annotation from the newest checkpoint, instead of upgrading them.")
+	phase.LocalFlags.BoolVar(&reconcileKubeletFlags, "reconcile-kubelet-flags", false,
+		"Rewrite kubeadm-flags.env to match the kubelet-extra-args annotation on this Node if the two have diverged. Without this flag, divergence is only logged as a warning.")
 	return phase
 }
 
@@ -73,22 +88,36 @@ func runKubeletConfigPhase() func(c workflow.RunData) error {
 		cfg := data.Cfg()
 		dryRun := data.DryRun()
 
-		// Set up the kubelet directory to use. If dry-running, this will return a fake directory
-		kubeletDir, err := upgrade.GetKubeletDir(dryRun)
-		if err != nil {
-			return err
+		// If requested, roll back the newest kubelet-config checkpoint instead of upgrading.
+		if kubeletConfigRollback {
+			if err := upgrade.RestoreKubeletConfig(data.Client(), patchnodephase.AnnotateCRISocket, patchnodephase.AnnotateKubeletExtraArgs, dryRun); err != nil {
+				return errors.Wrap(err, "could not roll back the kubelet configuration")
+			}
+			fmt.Println("[upgrade] The kubelet configuration for this node was successfully rolled back!")
+			return nil
 		}
 
-		// TODO: Checkpoint the current configuration first so that if something goes wrong it can be recovered
+		// Checkpoint the current, real, on-disk configuration first so that if something goes wrong it can be
+		// recovered with "kubeadm upgrade node phase kubelet-config --rollback". This always reads from the
+		// real kubelet directory, even when dry-running, since it's capturing what's there *today*.
+		if _, err := upgrade.CheckpointKubeletConfig(data.Client(), cfg.NodeRegistration.Name, constants.KubeletRunDirectory, cfg.KubernetesVersion, dryRun); err != nil {
+			return errors.Wrap(err, "error checkpointing the kubelet configuration before upgrading it")
+		}
 
-		// Store the kubelet component configuration.
-		if err = kubeletphase.WriteConfigToDisk(&cfg.ClusterConfiguration, kubeletDir); err != nil {
+		// Store the kubelet component configuration. If dry-running, sink keeps everything in memory so that
+		// this phase never writes to the filesystem.
+		sink := upgrade.NewKubeletAssetSink(dryRun)
+		if err := kubeletphase.WriteConfigTo(sink, &cfg.ClusterConfiguration); err != nil {
+			if restoreErr := upgrade.RestoreKubeletConfig(data.Client(), patchnodephase.AnnotateCRISocket, patchnodephase.AnnotateKubeletExtraArgs, dryRun); restoreErr != nil {
+				klog.Errorf("could not restore the previous kubelet configuration after a failed upgrade: %v", restoreErr)
+			}
 			return err
 		}
 
-		// If we're dry-running, print the generated manifests
+		// If we're dry-running, print what was generated and stop; nothing below this point should run
+		// against the live cluster while dry-running.
 		if dryRun {
-			if err := printFilesIfDryRunning(dryRun, kubeletDir); err != nil {
+			if err := dryrunutil.PrintAssetSink(sink, os.Stdout); err != nil {
 				return errors.Wrap(err, "error printing files on dryrun")
 			}
 			return nil
@@ -102,7 +131,7 @@ func runKubeletConfigPhase() func(c workflow.RunData) error {
 		//
 		// TODO: this workaround can be removed in 1.25 once all user node sockets have a URL scheme:
 		// https://github.com/kubernetes/kubeadm/issues/2426
-		var nro *kubeadmapi.NodeRegistrationOptions
+		nro := &kubeadmapi.NodeRegistrationOptions{}
 		var missingURLScheme bool
 		if !dryRun {
 			if err := configutil.GetNodeRegistration(data.KubeConfigPath(), data.Client(), nro); err != nil {
@@ -124,7 +153,21 @@ func runKubeletConfigPhase() func(c workflow.RunData) error {
 
 		// TODO: Temporary workaround. Remove in 1.25:
 		// https://github.com/kubernetes/kubeadm/issues/2426
-		if err := upgrade.UpdateKubeletDynamicEnvFileWithURLScheme(dryRun); err != nil {
+		if err := upgrade.UpdateKubeletDynamicEnvFileWithURLScheme(sink); err != nil {
+			return err
+		}
+
+		// Reconcile the KubeletExtraArgs kubeadm believes this node is running with (as recorded in the
+		// kubelet-extra-args annotation) against what is actually in kubeadm-flags.env on disk, rewriting the
+		// file only if --reconcile-kubelet-flags was passed.
+		if err := upgrade.ReconcileKubeletExtraArgs(nro.KubeletExtraArgs, reconcileKubeletFlags, dryRun); err != nil {
+			return errors.Wrap(err, "error reconciling the kubelet extra args")
+		}
+
+		// Bootstrap (or refresh) the kubelet-extra-args annotation and the canonical node instance config, so
+		// that nodes upgraded from a version that predates them pick up the file-based node identity instead of
+		// relying on the client certificate.
+		if err := kubeletphase.PersistNodeIdentity(data.Client(), nro); err != nil {
 			return err
 		}
 
@@ -133,17 +176,3 @@ func runKubeletConfigPhase() func(c workflow.RunData) error {
 		return nil
 	}
 }
-
-// printFilesIfDryRunning prints the Static Pod manifests to stdout and informs about the temporary directory to go and lookup
-func printFilesIfDryRunning(dryRun bool, kubeletDir string) error {
-	if !dryRun {
-		return nil
-	}
-
-	// Print the contents of the upgraded file and pretend like they were in kubeadmconstants.KubeletRunDirectory
-	fileToPrint := dryrunutil.FileToPrint{
-		RealPath:  filepath.Join(kubeletDir, constants.KubeletConfigurationFileName),
-		PrintPath: filepath.Join(constants.KubeletRunDirectory, constants.KubeletConfigurationFileName),
-	}
-	return dryrunutil.PrintDryRunFiles([]dryrunutil.FileToPrint{fileToPrint}, os.Stdout)
-}
@@ -0,0 +1,51 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"github.com/pkg/errors"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	"k8s.io/kubernetes/cmd/kubeadm/app/componentconfigs"
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	dryrunutil "k8s.io/kubernetes/cmd/kubeadm/app/util/dryrun"
+)
+
+// WriteConfigToDisk writes the kubelet component configuration, as found in cfg, to kubeletDir on the real
+// filesystem. It is a thin wrapper around WriteConfigTo for callers that always want to write for real.
+func WriteConfigToDisk(cfg *kubeadmapi.ClusterConfiguration, kubeletDir string) error {
+	return WriteConfigTo(dryrunutil.NewDiskAssetSink(kubeletDir), cfg)
+}
+
+// WriteConfigTo marshals the kubelet component configuration found in cfg and writes it through sink, so
+// that callers running with --dry-run can pass a dryrunutil.MemoryAssetSink instead of touching disk.
+func WriteConfigTo(sink dryrunutil.AssetSink, cfg *kubeadmapi.ClusterConfiguration) error {
+	kubeletCfg, ok := cfg.ComponentConfigs[componentconfigs.KubeletGroup]
+	if !ok {
+		return errors.New("no kubelet component config found in the active component config set")
+	}
+
+	data, err := kubeletCfg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal kubelet component config")
+	}
+
+	if err := sink.Write(constants.KubeletConfigurationFileName, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write the kubelet configuration")
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"github.com/pkg/errors"
+
+	clientset "k8s.io/client-go/kubernetes"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmapiv1 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
+	patchnodephase "k8s.io/kubernetes/cmd/kubeadm/app/phases/patchnode"
+	configutil "k8s.io/kubernetes/cmd/kubeadm/app/util/config"
+)
+
+// PersistNodeIdentity records this node's identity so that both the Node object and the canonical node
+// instance config file agree with what kubeadm just registered the node with: the kubelet-extra-args
+// annotation is set (or updated) on the Node, and the node instance config is written (or refreshed) on
+// disk. It is called by the kubelet-finalize phase of "kubeadm init"/"join", and again on every
+// "kubeadm upgrade node" run, so that neither source of truth is ever missing or stale.
+func PersistNodeIdentity(client clientset.Interface, nro *kubeadmapi.NodeRegistrationOptions) error {
+	if err := patchnodephase.AnnotateKubeletExtraArgs(client, nro.Name, nro.KubeletExtraArgs); err != nil {
+		return errors.Wrapf(err, "error updating the kubelet extra args annotation for Node %q", nro.Name)
+	}
+
+	if err := configutil.WriteNodeInstanceConfig(configutil.NodeInstanceConfigPath(), &kubeadmapiv1.NodeInstanceConfig{
+		NodeName:         nro.Name,
+		CRISocket:        nro.CRISocket,
+		KubeletExtraArgs: nro.KubeletExtraArgs,
+	}); err != nil {
+		return errors.Wrap(err, "error writing the node instance config")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patchnode
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+// kubeletExtraArgsPatch is the shape of the JSON merge patch sent by AnnotateKubeletExtraArgs.
+type kubeletExtraArgsPatch struct {
+	Metadata kubeletExtraArgsPatchMetadata `json:"metadata"`
+}
+
+type kubeletExtraArgsPatchMetadata struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// AnnotateKubeletExtraArgs annotates the node with the given kubeletExtraArgs, serialized as JSON, mirroring
+// what AnnotateCRISocket does for the CRI socket. This lets "kubeadm upgrade node" detect drift between the
+// NodeRegistration.KubeletExtraArgs kubeadm believes a node is running with and the kubeadm-flags.env file
+// actually in effect on disk.
+func AnnotateKubeletExtraArgs(client clientset.Interface, nodeName string, kubeletExtraArgs map[string]string) error {
+	encoded, err := json.Marshal(kubeletExtraArgs)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling kubelet extra args")
+	}
+
+	patch, err := json.Marshal(kubeletExtraArgsPatch{
+		Metadata: kubeletExtraArgsPatchMetadata{
+			Annotations: map[string]string{
+				constants.AnnotationKubeadmKubeletExtraArgs: string(encoded),
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error marshalling the kubelet extra args patch")
+	}
+
+	_, err = client.CoreV1().Nodes().Patch(
+		context.TODO(),
+		nodeName,
+		types.MergePatchType,
+		patch,
+		metav1.PatchOptions{},
+	)
+	if err != nil {
+		return errors.Wrapf(err, "error patching Node %q with the kubelet extra args annotation", nodeName)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	dryrunutil "k8s.io/kubernetes/cmd/kubeadm/app/util/dryrun"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+// NewKubeletAssetSink returns the dryrunutil.AssetSink that kubelet-config upgrade phases should write the
+// new kubelet configuration through. When dryRun is true the returned sink keeps everything in memory so
+// that dry-running never touches the filesystem; otherwise it writes straight to
+// constants.KubeletRunDirectory.
+func NewKubeletAssetSink(dryRun bool) dryrunutil.AssetSink {
+	if dryRun {
+		return dryrunutil.NewMemoryAssetSink(constants.KubeletRunDirectory)
+	}
+	return dryrunutil.NewDiskAssetSink(constants.KubeletRunDirectory)
+}
@@ -0,0 +1,373 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	pkgversion "k8s.io/kubernetes/pkg/version"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	configutil "k8s.io/kubernetes/cmd/kubeadm/app/util/config"
+	dryrunutil "k8s.io/kubernetes/cmd/kubeadm/app/util/dryrun"
+)
+
+const (
+	// kubeletCheckpointParentDir is the directory kubeadm keeps kubelet-config checkpoints in.
+	kubeletCheckpointParentDir = "kubelet-checkpoints"
+	// kubeletCheckpointManifestFileName is the name of the checkpoint's manifest file.
+	kubeletCheckpointManifestFileName = "manifest.json"
+	// kubeletCheckpointTimeFormat is used to build a sortable, unique checkpoint directory name.
+	kubeletCheckpointTimeFormat = "2006-01-02-15-04-05"
+)
+
+// KubeletCheckpointFile describes a single file (or blob) that was captured as part of a kubelet-config checkpoint.
+type KubeletCheckpointFile struct {
+	// Name identifies the file within the checkpoint directory, e.g. "config.yaml".
+	Name string `json:"name"`
+	// SourcePath is the original, absolute on-disk path the blob was read from.
+	SourcePath string `json:"sourcePath"`
+	// SHA256 is the hex-encoded SHA-256 sum of the blob as it was captured.
+	SHA256 string `json:"sha256"`
+}
+
+// KubeletCheckpointManifest records everything needed to validate and restore a kubelet-config checkpoint.
+type KubeletCheckpointManifest struct {
+	// KubeadmVersion is the GitVersion of the kubeadm binary that took the checkpoint.
+	KubeadmVersion string `json:"kubeadmVersion"`
+	// KubeletVersion is the kubelet version kubeadm was about to upgrade the node to.
+	KubeletVersion string `json:"kubeletVersion"`
+	// Timestamp is when the checkpoint was taken, in RFC3339.
+	Timestamp string `json:"timestamp"`
+	// NodeName is the node the checkpoint belongs to.
+	NodeName string `json:"nodeName"`
+	// CRISocketAnnotation is the value of the CRI-socket annotation on the Node object at checkpoint time.
+	CRISocketAnnotation string `json:"criSocketAnnotation,omitempty"`
+	// KubeletExtraArgsAnnotation is the value of the kubelet-extra-args annotation on the Node object at
+	// checkpoint time.
+	KubeletExtraArgsAnnotation string `json:"kubeletExtraArgsAnnotation,omitempty"`
+	// ConfigMap is the in-cluster kubelet-config ConfigMap captured at checkpoint time, if it could be read.
+	ConfigMap *KubeletConfigMapCheckpoint `json:"configMap,omitempty"`
+	// Files lists every blob captured by the checkpoint, keyed by Name.
+	Files []KubeletCheckpointFile `json:"files"`
+}
+
+// KubeletConfigMapCheckpoint records the in-cluster kubelet-config ConfigMap that was captured alongside the
+// on-disk files, so that a rollback can also restore the cluster's view of the kubelet base configuration.
+type KubeletConfigMapCheckpoint struct {
+	// Name is the name of the ConfigMap in the kube-system namespace, e.g. "kubelet-config-1.24".
+	Name string `json:"name"`
+	// Data is the ConfigMap's Data as it was at checkpoint time.
+	Data map[string]string `json:"data"`
+}
+
+// checkpointFile is a single source file that a checkpoint should capture.
+type checkpointFile struct {
+	name       string
+	sourcePath string
+	required   bool
+}
+
+// filesToCheckpoint returns the set of on-disk files that make up a kubelet-config checkpoint.
+func filesToCheckpoint(kubeletDir string) []checkpointFile {
+	return []checkpointFile{
+		{name: constants.KubeletConfigurationFileName, sourcePath: filepath.Join(kubeletDir, constants.KubeletConfigurationFileName), required: true},
+		{name: constants.KubeletEnvFileName, sourcePath: filepath.Join(kubeletDir, constants.KubeletEnvFileName), required: false},
+		{name: configutil.NodeInstanceConfigFileName, sourcePath: configutil.NodeInstanceConfigPath(), required: false},
+	}
+}
+
+// CheckpointKubeletConfig snapshots the on-disk kubelet configuration, the kubeadm-flags.env file, the
+// Node's CRI-socket annotation and the in-cluster kubelet-config ConfigMap into a new, versioned checkpoint
+// directory under constants.KubernetesDir/tmp, so that a failed "upgrade node" run can be rolled back.
+// If dryRun is true, no files are written to disk and the actions that would be taken are printed instead.
+func CheckpointKubeletConfig(client clientset.Interface, nodeName, kubeletDir, kubeletVersion string, dryRun bool) (string, error) {
+	checkpointDir := filepath.Join(constants.KubernetesDir, constants.TempDirForKubeadm, kubeletCheckpointParentDir, time.Now().Format(kubeletCheckpointTimeFormat))
+
+	manifest := KubeletCheckpointManifest{
+		KubeadmVersion: pkgversion.Get().GitVersion,
+		KubeletVersion: kubeletVersion,
+		Timestamp:      time.Now().Format(time.RFC3339),
+		NodeName:       nodeName,
+	}
+
+	node, err := client.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.V(1).Infof("[upgrade/kubelet-checkpoint] could not read Node %q, continuing without its annotations or ConfigMap: %v", nodeName, err)
+	} else {
+		manifest.CRISocketAnnotation = node.Annotations[constants.AnnotationKubeadmCRISocket]
+		manifest.KubeletExtraArgsAnnotation = node.Annotations[constants.AnnotationKubeadmKubeletExtraArgs]
+
+		// kubeletVersion is the version being upgraded *to*: by the time "upgrade node" runs, "upgrade apply"
+		// has already created the target kubelet-config ConfigMap on the control plane, so using it here
+		// would checkpoint the post-upgrade ConfigMap instead of the one actually being replaced. The kubelet
+		// version the Node is currently running is the one we need to look up and roll back to.
+		currentKubeletVersion := node.Status.NodeInfo.KubeletVersion
+		if configMap, err := getKubeletConfigMap(client, currentKubeletVersion); err == nil {
+			manifest.ConfigMap = &KubeletConfigMapCheckpoint{Name: configMap.Name, Data: configMap.Data}
+		} else {
+			klog.V(1).Infof("[upgrade/kubelet-checkpoint] could not read the kubelet-config ConfigMap for the currently running kubelet version %q, continuing without it: %v", currentKubeletVersion, err)
+		}
+	}
+
+	var filesToPrint []dryrunutil.FileToPrint
+	for _, f := range filesToCheckpoint(kubeletDir) {
+		data, err := ioutil.ReadFile(f.sourcePath)
+		if err != nil {
+			if os.IsNotExist(err) && !f.required {
+				continue
+			}
+			return "", errors.Wrapf(err, "could not read %q while checkpointing kubelet config", f.sourcePath)
+		}
+
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, KubeletCheckpointFile{
+			Name:       f.name,
+			SourcePath: f.sourcePath,
+			SHA256:     hex.EncodeToString(sum[:]),
+		})
+
+		if dryRun {
+			filesToPrint = append(filesToPrint, dryrunutil.FileToPrint{
+				RealPath:  f.sourcePath,
+				PrintPath: filepath.Join(checkpointDir, f.name),
+			})
+			continue
+		}
+
+		if err := writeCheckpointBlob(checkpointDir, f.name, data); err != nil {
+			return "", err
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err, "could not marshal kubelet-config checkpoint manifest")
+	}
+
+	if dryRun {
+		fmt.Printf("[dryrun] Would checkpoint the current kubelet configuration to %q\n", checkpointDir)
+		return checkpointDir, dryrunutil.PrintDryRunFiles(filesToPrint, os.Stdout)
+	}
+
+	if err := writeCheckpointBlob(checkpointDir, kubeletCheckpointManifestFileName, manifestData); err != nil {
+		return "", err
+	}
+
+	klog.V(2).Infof("[upgrade/kubelet-checkpoint] checkpointed kubelet config for Node %q to %q", nodeName, checkpointDir)
+	return checkpointDir, nil
+}
+
+// RestoreKubeletConfig validates the newest kubelet-config checkpoint found under constants.KubernetesDir/tmp
+// and atomically restores the files it captured, re-annotating the Node with the CRI socket and
+// kubelet-extra-args it was last known to have and restoring the in-cluster kubelet-config ConfigMap. It is
+// the symmetric counterpart of CheckpointKubeletConfig.
+func RestoreKubeletConfig(client clientset.Interface, annotateCRISocket func(clientset.Interface, string, string) error, annotateKubeletExtraArgs func(clientset.Interface, string, map[string]string) error, dryRun bool) error {
+	checkpointDir, err := latestCheckpointDir()
+	if err != nil {
+		return err
+	}
+
+	manifest, err := readCheckpointManifest(checkpointDir)
+	if err != nil {
+		return err
+	}
+
+	// Validate every blob before restoring any of them, so that a corrupt checkpoint restores nothing.
+	blobs := make([][]byte, len(manifest.Files))
+	for i, f := range manifest.Files {
+		blobPath := filepath.Join(checkpointDir, f.Name)
+		data, err := ioutil.ReadFile(blobPath)
+		if err != nil {
+			return errors.Wrapf(err, "could not read checkpointed file %q", blobPath)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			return errors.Errorf("checksum mismatch for checkpointed file %q: the checkpoint may be corrupt", blobPath)
+		}
+		blobs[i] = data
+	}
+
+	var filesToPrint []dryrunutil.FileToPrint
+	for i, f := range manifest.Files {
+		if dryRun {
+			filesToPrint = append(filesToPrint, dryrunutil.FileToPrint{RealPath: filepath.Join(checkpointDir, f.Name), PrintPath: f.SourcePath})
+			continue
+		}
+
+		if err := atomicWriteFile(f.SourcePath, blobs[i]); err != nil {
+			return errors.Wrapf(err, "could not restore %q from checkpoint", f.SourcePath)
+		}
+	}
+
+	if dryRun {
+		if err := dryrunutil.PrintDryRunFiles(filesToPrint, os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if manifest.CRISocketAnnotation != "" {
+		if dryRun {
+			fmt.Printf("[dryrun] Would restore CRI socket annotation %q on Node %q\n", manifest.CRISocketAnnotation, manifest.NodeName)
+		} else if err := annotateCRISocket(client, manifest.NodeName, manifest.CRISocketAnnotation); err != nil {
+			return errors.Wrapf(err, "could not restore the CRI socket annotation for Node %q", manifest.NodeName)
+		}
+	}
+
+	if manifest.KubeletExtraArgsAnnotation != "" {
+		if dryRun {
+			fmt.Printf("[dryrun] Would restore kubelet extra args annotation %q on Node %q\n", manifest.KubeletExtraArgsAnnotation, manifest.NodeName)
+		} else {
+			extraArgs := map[string]string{}
+			if err := json.Unmarshal([]byte(manifest.KubeletExtraArgsAnnotation), &extraArgs); err != nil {
+				return errors.Wrapf(err, "could not parse the checkpointed kubelet extra args annotation for Node %q", manifest.NodeName)
+			}
+			if err := annotateKubeletExtraArgs(client, manifest.NodeName, extraArgs); err != nil {
+				return errors.Wrapf(err, "could not restore the kubelet extra args annotation for Node %q", manifest.NodeName)
+			}
+		}
+	}
+
+	if manifest.ConfigMap != nil {
+		if dryRun {
+			fmt.Printf("[dryrun] Would restore ConfigMap %q in namespace %q\n", manifest.ConfigMap.Name, metav1.NamespaceSystem)
+		} else if err := restoreKubeletConfigMap(client, manifest.ConfigMap); err != nil {
+			return errors.Wrapf(err, "could not restore the kubelet-config ConfigMap %q", manifest.ConfigMap.Name)
+		}
+	}
+
+	klog.V(2).Infof("[upgrade/kubelet-checkpoint] restored kubelet config for Node %q from %q", manifest.NodeName, checkpointDir)
+	return nil
+}
+
+// restoreKubeletConfigMap overwrites the Data of the in-cluster kubelet-config ConfigMap with what was
+// captured at checkpoint time.
+func restoreKubeletConfigMap(client clientset.Interface, checkpoint *KubeletConfigMapCheckpoint) error {
+	configMaps := client.CoreV1().ConfigMaps(metav1.NamespaceSystem)
+	configMap, err := configMaps.Get(context.TODO(), checkpoint.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	configMap.Data = checkpoint.Data
+	_, err = configMaps.Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	return err
+}
+
+// kubeletConfigMapName returns the name of the in-cluster ConfigMap that holds the kubelet base
+// configuration for kubeletVersion, e.g. "kubelet-config-1.24" for kubelet version v1.24.3.
+func kubeletConfigMapName(kubeletVersion string) (string, error) {
+	parsed, err := version.ParseGeneric(kubeletVersion)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not parse kubelet version %q", kubeletVersion)
+	}
+	return fmt.Sprintf("kubelet-config-%d.%d", parsed.Major(), parsed.Minor()), nil
+}
+
+// getKubeletConfigMap fetches the in-cluster kubelet-config ConfigMap for kubeletVersion.
+func getKubeletConfigMap(client clientset.Interface, kubeletVersion string) (*corev1.ConfigMap, error) {
+	name, err := kubeletConfigMapName(kubeletVersion)
+	if err != nil {
+		return nil, err
+	}
+	return client.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// latestCheckpointDir returns the most recent checkpoint directory, relying on the fact that
+// kubeletCheckpointTimeFormat sorts lexically in chronological order.
+func latestCheckpointDir() (string, error) {
+	root := filepath.Join(constants.KubernetesDir, constants.TempDirForKubeadm, kubeletCheckpointParentDir)
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not list kubelet-config checkpoints in %q", root)
+	}
+
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, e.Name())
+		}
+	}
+	if len(dirs) == 0 {
+		return "", errors.Errorf("no kubelet-config checkpoints found in %q", root)
+	}
+	sort.Strings(dirs)
+	return filepath.Join(root, dirs[len(dirs)-1]), nil
+}
+
+func readCheckpointManifest(checkpointDir string) (*KubeletCheckpointManifest, error) {
+	manifestPath := filepath.Join(checkpointDir, kubeletCheckpointManifestFileName)
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read checkpoint manifest %q", manifestPath)
+	}
+
+	manifest := &KubeletCheckpointManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, errors.Wrapf(err, "could not parse checkpoint manifest %q", manifestPath)
+	}
+	return manifest, nil
+}
+
+func writeCheckpointBlob(checkpointDir, name string, data []byte) error {
+	if err := os.MkdirAll(checkpointDir, 0700); err != nil {
+		return errors.Wrapf(err, "could not create checkpoint directory %q", checkpointDir)
+	}
+	if err := ioutil.WriteFile(filepath.Join(checkpointDir, name), data, 0600); err != nil {
+		return errors.Wrapf(err, "could not write checkpoint file %q", name)
+	}
+	return nil
+}
+
+// atomicWriteFile writes data to a temporary file in the same directory as path and then renames it into
+// place, so that a crash or concurrent read never observes a partially written file.
+func atomicWriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
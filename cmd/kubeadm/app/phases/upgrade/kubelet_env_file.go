@@ -0,0 +1,55 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	kubeadmapiv1 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	dryrunutil "k8s.io/kubernetes/cmd/kubeadm/app/util/dryrun"
+)
+
+// UpdateKubeletDynamicEnvFileWithURLScheme ensures that the "--container-runtime-endpoint" flag recorded in
+// kubeadm-flags.env carries a URL scheme (e.g. unix://), rewriting the file through sink if it doesn't.
+//
+// TODO: this workaround can be removed in 1.25 once all user node sockets have a URL scheme:
+// https://github.com/kubernetes/kubeadm/issues/2426
+func UpdateKubeletDynamicEnvFileWithURLScheme(sink dryrunutil.AssetSink) error {
+	const criSocketFlag = "container-runtime-endpoint"
+
+	args, err := ParseKubeletFlagsEnvFile(kubeletFlagsEnvFilePath())
+	if err != nil {
+		return err
+	}
+
+	socket, ok := args[criSocketFlag]
+	if !ok || strings.Contains(socket, "://") {
+		return nil
+	}
+
+	args[criSocketFlag] = kubeadmapiv1.DefaultContainerRuntimeURLScheme + "://" + socket
+	klog.V(2).Infof("[upgrade/kubelet-env-file] adding the missing URL scheme to the %q flag in %s", criSocketFlag, constants.KubeletEnvFileName)
+
+	if err := sink.Write(constants.KubeletEnvFileName, []byte(FormatKubeletFlagsEnvFile(args)), 0644); err != nil {
+		return errors.Wrapf(err, "could not update %s with a URL scheme for the CRI socket", constants.KubeletEnvFileName)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+// kubeletFlagsEnvFilePath returns the absolute path to the kubeadm-flags.env file on disk.
+func kubeletFlagsEnvFilePath() string {
+	return filepath.Join(constants.KubeletRunDirectory, constants.KubeletEnvFileName)
+}
+
+// ParseKubeletFlagsEnvFile reads a kubeadm-flags.env file and returns the flags it sets, keyed without
+// their leading "--". A missing file is treated as "no flags set" rather than an error.
+func ParseKubeletFlagsEnvFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, errors.Wrapf(err, "could not read %q", path)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		prefix := constants.KubeletEnvFileVariableName + "="
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		value := strings.Trim(strings.TrimPrefix(line, prefix), `"`)
+		return splitKubeletFlags(value), nil
+	}
+	return map[string]string{}, nil
+}
+
+// FormatKubeletFlagsEnvFile renders args back into the kubeadm-flags.env format.
+func FormatKubeletFlagsEnvFile(args map[string]string) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	flags := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if v := args[k]; v != "" {
+			flags = append(flags, fmt.Sprintf("--%s=%s", k, v))
+		} else {
+			flags = append(flags, fmt.Sprintf("--%s", k))
+		}
+	}
+	return fmt.Sprintf("%s=%q\n", constants.KubeletEnvFileVariableName, strings.Join(flags, " "))
+}
+
+func splitKubeletFlags(value string) map[string]string {
+	args := map[string]string{}
+	for _, flag := range strings.Fields(value) {
+		flag = strings.TrimPrefix(flag, "--")
+		if flag == "" {
+			continue
+		}
+		parts := strings.SplitN(flag, "=", 2)
+		if len(parts) == 2 {
+			args[parts[0]] = parts[1]
+		} else {
+			args[parts[0]] = ""
+		}
+	}
+	return args
+}
+
+// ReconcileKubeletExtraArgs compares the KubeletExtraArgs kubeadm believes a node is running with (as
+// recorded in the kubeadm.alpha.kubernetes.io/kubelet-extra-args annotation and passed in via
+// wantedExtraArgs) against what is actually on disk in kubeadm-flags.env. kubeadm-flags.env also carries
+// base flags that kubeadm itself computes (e.g. --container-runtime-endpoint) and that are never part of
+// KubeletExtraArgs, so only the wantedExtraArgs subset of the on-disk flags is considered here; the base
+// flags are left untouched.
+//
+// If the subset already matches, this is a no-op. If it diverges and reconcile is false, a warning is
+// logged so that users who hand-edited kubeadm-flags.env are not silently overwritten. If it diverges and
+// reconcile is true, wantedExtraArgs is merged on top of the existing on-disk flags and the file is
+// rewritten with the result (or, when dryRun is true, the rewrite is only printed).
+func ReconcileKubeletExtraArgs(wantedExtraArgs map[string]string, reconcile, dryRun bool) error {
+	path := kubeletFlagsEnvFilePath()
+	onDisk, err := ParseKubeletFlagsEnvFile(path)
+	if err != nil {
+		return err
+	}
+
+	if extraArgsMatch(onDisk, wantedExtraArgs) {
+		return nil
+	}
+
+	if !reconcile {
+		klog.Warningf("[upgrade/kubelet-extra-args] the kubelet flags on disk in %q do not match the %q annotation on this Node;"+
+			" this usually means kubeadm-flags.env was edited by hand. Re-run with --reconcile-kubelet-flags to overwrite it with the annotated value", path, constants.AnnotationKubeadmKubeletExtraArgs)
+		return nil
+	}
+
+	merged := mergeKubeletFlags(onDisk, wantedExtraArgs)
+	rendered := FormatKubeletFlagsEnvFile(merged)
+	if dryRun {
+		fmt.Printf("[dryrun] Would write the following to %q:\n%s", path, rendered)
+		return nil
+	}
+
+	if err := ioutil.WriteFile(path, []byte(rendered), 0644); err != nil {
+		return errors.Wrapf(err, "could not reconcile %q", path)
+	}
+	klog.V(2).Infof("[upgrade/kubelet-extra-args] reconciled %q with the kubelet extra args annotation", path)
+	return nil
+}
+
+// extraArgsMatch reports whether every flag in wanted is already present in onDisk with the same value.
+// onDisk is allowed to carry additional base flags that wanted doesn't mention.
+func extraArgsMatch(onDisk, wanted map[string]string) bool {
+	for k, v := range wanted {
+		if ov, ok := onDisk[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeKubeletFlags returns a copy of base with every flag in overlay applied on top of it, so that
+// reconciling wantedExtraArgs never drops the base flags kubeadm itself computed.
+func mergeKubeletFlags(base, overlay map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overlay))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overlay {
+		merged[k] = v
+	}
+	return merged
+}
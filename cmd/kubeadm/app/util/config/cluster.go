@@ -19,10 +19,14 @@ package config
 import (
 	"context"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -33,6 +37,7 @@ import (
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/klog/v2"
 
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 	kubeadmscheme "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/scheme"
@@ -120,10 +125,18 @@ func getInitConfigurationFromCluster(kubeconfigDir string, client clientset.Inte
 
 // GetNodeRegistration returns the nodeRegistration for the current node
 func GetNodeRegistration(kubeconfigFile string, client clientset.Interface, nodeRegistration *kubeadmapi.NodeRegistrationOptions) error {
-	// gets the name of the current node
-	nodeName, err := getNodeNameFromKubeletConfig(kubeconfigFile)
+	// gets the name of the current node, preferring the canonical, kubeadm-owned instance config file over
+	// parsing it out of the kubelet client certificate, which is fragile around certificate rotation.
+	nodeName, err := getNodeNameFromInstanceConfig()
 	if err != nil {
-		return errors.Wrap(err, "failed to get node name from kubelet config")
+		if !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to get node name from the node instance config")
+		}
+		klog.V(1).Infof("no node instance config found at %s, falling back to resolving the node name from the kubelet client certificate", NodeInstanceConfigPath())
+		nodeName, err = getNodeNameFromKubeletConfig(kubeconfigFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to get node name from kubelet config")
+		}
 	}
 
 	// gets the corresponding node and retrieves attributes stored there.
@@ -141,54 +154,132 @@ func GetNodeRegistration(kubeconfigFile string, client clientset.Interface, node
 	nodeRegistration.Name = nodeName
 	nodeRegistration.CRISocket = criSocket
 	nodeRegistration.Taints = node.Spec.Taints
-	// NB. currently nodeRegistration.KubeletExtraArgs isn't stored at node level but only in the kubeadm-flags.env
-	//     that isn't modified during upgrades
-	//     in future we might reconsider this thus enabling changes to the kubeadm-flags.env during upgrades as well
+
+	// KubeletExtraArgs is persisted at init/join time as a JSON-encoded annotation, so that "upgrade node"
+	// can detect and reconcile drift against the kubeadm-flags.env file actually in effect on disk. Older
+	// nodes that predate this annotation simply report no extra args here; the flags in kubeadm-flags.env on
+	// disk are left untouched in that case.
+	if raw, ok := node.ObjectMeta.Annotations[constants.AnnotationKubeadmKubeletExtraArgs]; ok {
+		extraArgs := map[string]string{}
+		if err := json.Unmarshal([]byte(raw), &extraArgs); err != nil {
+			return errors.Wrapf(err, "could not parse the %s annotation on node %s", constants.AnnotationKubeadmKubeletExtraArgs, nodeName)
+		}
+		nodeRegistration.KubeletExtraArgs = extraArgs
+	}
 	return nil
 }
 
-// getNodeNameFromKubeletConfig gets the node name from a kubelet config file
-// TODO: in future we want to switch to a more canonical way for doing this e.g. by having this
-//       information in the local kubelet config.yaml
+// getNodeNameFromInstanceConfig reads the node name out of the canonical node instance config file. It
+// returns an os.IsNotExist error unchanged so that callers can detect nodes that predate this file.
+func getNodeNameFromInstanceConfig() (string, error) {
+	cfg, err := LoadNodeInstanceConfig(NodeInstanceConfigPath())
+	if err != nil {
+		return "", err
+	}
+	return cfg.NodeName, nil
+}
+
+// getNodeNameFromKubeletConfig gets the node name from a kubelet config file by parsing the kubelet client
+// certificate. This is now only a fallback for nodes that predate the node instance config file handled by
+// getNodeNameFromInstanceConfig; see GetNodeRegistration.
 func getNodeNameFromKubeletConfig(fileName string) (string, error) {
+	certs, err := certsFromKubeletConfig(fileName)
+	if err != nil {
+		return "", err
+	}
+
+	return nodeNameFromCerts(fileName, certs)
+}
+
+// certsFromKubeletConfig loads the kubeconfig at fileName and parses the x509 certificate(s) associated
+// with its current user, either embedded in the file or linked from an external file on disk.
+func certsFromKubeletConfig(fileName string) ([]*x509.Certificate, error) {
 	// loads the kubelet.conf file
 	config, err := clientcmd.LoadFromFile(fileName)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// gets the info about the current user
 	currentContext, exists := config.Contexts[config.CurrentContext]
 	if !exists {
-		return "", errors.Errorf("invalid kubeconfig file %s: missing context %s", fileName, config.CurrentContext)
+		return nil, errors.Errorf("invalid kubeconfig file %s: missing context %s", fileName, config.CurrentContext)
 	}
 	authInfo, exists := config.AuthInfos[currentContext.AuthInfo]
 	if !exists {
-		return "", errors.Errorf("invalid kubeconfig file %s: missing AuthInfo %s", fileName, currentContext.AuthInfo)
+		return nil, errors.Errorf("invalid kubeconfig file %s: missing AuthInfo %s", fileName, currentContext.AuthInfo)
 	}
 
-	// gets the X509 certificate with current user credentials
+	// gets the X509 certificate(s) with current user credentials
 	var certs []*x509.Certificate
 	if len(authInfo.ClientCertificateData) > 0 {
-		// if the config file uses an embedded x509 certificate (e.g. kubelet.conf created by kubeadm), parse it
+		// if the config file uses embedded x509 certificate(s) (e.g. kubelet.conf created by kubeadm), parse them.
+		// During client-cert rotation this blob can contain more than one concatenated PEM block: the live
+		// certificate plus one being rotated in.
 		if certs, err = certutil.ParseCertsPEM(authInfo.ClientCertificateData); err != nil {
-			return "", err
+			return nil, err
 		}
 	} else if len(authInfo.ClientCertificate) > 0 {
 		// if the config file links an external x509 certificate (e.g. kubelet.conf created by TLS bootstrap), load it
 		if certs, err = certutil.CertsFromFile(authInfo.ClientCertificate); err != nil {
-			return "", err
+			return nil, err
 		}
 	} else {
-		return "", errors.Errorf("invalid kubeconfig file %s. x509 certificate expected", fileName)
+		return nil, errors.Errorf("invalid kubeconfig file %s. x509 certificate expected", fileName)
+	}
+
+	return certs, nil
+}
+
+// nodeNameFromCerts picks the node name out of a set of candidate client certificates loaded from fileName.
+// Certificates that are expired, not yet valid, or whose Subject.CommonName doesn't carry the kubeadm node-user prefix are
+// discarded; among the remaining, currently-valid certificates, the one with the latest NotBefore wins, as
+// it represents the newest credential issued to the node (e.g. during client-cert rotation). If the
+// surviving certificates disagree on the node name, or none of them are valid, an actionable error is
+// returned naming the kubeconfig file and the expiry dates that were found.
+func nodeNameFromCerts(fileName string, certs []*x509.Certificate) (string, error) {
+	now := time.Now()
+	var candidates []*x509.Certificate
+	var expiries []string
+
+	for _, cert := range certs {
+		if !strings.HasPrefix(cert.Subject.CommonName, constants.NodesUserPrefix) {
+			continue
+		}
+		if now.After(cert.NotAfter) {
+			expiries = append(expiries, fmt.Sprintf("%s (expired %s)", cert.Subject.CommonName, cert.NotAfter))
+			continue
+		}
+		if now.Before(cert.NotBefore) {
+			expiries = append(expiries, fmt.Sprintf("%s (not valid before %s)", cert.Subject.CommonName, cert.NotBefore))
+			continue
+		}
+		candidates = append(candidates, cert)
+	}
+
+	if len(candidates) == 0 {
+		return "", errors.Errorf("invalid kubeconfig file %s: found no currently valid client certificate with the %q prefix; candidates found: %s",
+			fileName, constants.NodesUserPrefix, strings.Join(expiries, ", "))
 	}
 
-	// We are only putting one certificate in the certificate pem file, so it's safe to just pick the first one
-	// TODO: Support multiple certs here in order to be able to rotate certs
-	cert := certs[0]
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].NotBefore.After(candidates[j].NotBefore)
+	})
+
+	// All currently-valid certificates are expected to agree on the node name: rotation only ever reissues a
+	// new certificate for the *same* node, so an older, still-valid certificate for a different name isn't a
+	// "supersede" situation, it's two certificates claiming to be different nodes. Picking the newest one
+	// silently in that case would risk registering as the wrong node.
+	newestName := strings.TrimPrefix(candidates[0].Subject.CommonName, constants.NodesUserPrefix)
+	for _, cert := range candidates[1:] {
+		name := strings.TrimPrefix(cert.Subject.CommonName, constants.NodesUserPrefix)
+		if name != newestName {
+			return "", errors.Errorf("invalid kubeconfig file %s: found multiple currently valid client certificates for different node names (%q and %q)",
+				fileName, newestName, name)
+		}
+	}
 
-	// gets the node name from the certificate common name
-	return strings.TrimPrefix(cert.Subject.CommonName, constants.NodesUserPrefix), nil
+	return newestName, nil
 }
 
 func getAPIEndpoint(client clientset.Interface, nodeName string, apiEndpoint *kubeadmapi.APIEndpoint) error {
@@ -0,0 +1,208 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	clientcmd "k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+// newTestCert creates a self-signed, DER-encoded x509 certificate for use in the tests below.
+func newTestCert(t *testing.T, commonName string, notBefore, notAfter time.Time) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate test key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create test certificate: %v", err)
+	}
+	return der
+}
+
+func pemEncode(ders ...[]byte) []byte {
+	var out []byte
+	for _, der := range ders {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return out
+}
+
+func mustParse(t *testing.T, der []byte) *x509.Certificate {
+	t.Helper()
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("could not parse test certificate: %v", err)
+	}
+	return cert
+}
+
+func TestNodeNameFromCerts(t *testing.T) {
+	now := time.Now()
+	nodeName := constants.NodesUserPrefix + "my-node"
+	otherNodeName := constants.NodesUserPrefix + "other-node"
+
+	tests := []struct {
+		name      string
+		certs     []*x509.Certificate
+		expected  string
+		expectErr bool
+	}{
+		{
+			name: "expired-first/valid-second",
+			certs: []*x509.Certificate{
+				mustParse(t, newTestCert(t, nodeName, now.Add(-48*time.Hour), now.Add(-1*time.Hour))),
+				mustParse(t, newTestCert(t, nodeName, now.Add(-1*time.Hour), now.Add(48*time.Hour))),
+			},
+			expected: "my-node",
+		},
+		{
+			name: "two-valid-different-names",
+			certs: []*x509.Certificate{
+				mustParse(t, newTestCert(t, nodeName, now.Add(-2*time.Hour), now.Add(48*time.Hour))),
+				mustParse(t, newTestCert(t, otherNodeName, now.Add(-1*time.Hour), now.Add(48*time.Hour))),
+			},
+			expectErr: true,
+		},
+		{
+			name: "rotation-in-progress-newest-wins",
+			certs: []*x509.Certificate{
+				mustParse(t, newTestCert(t, nodeName, now.Add(-48*time.Hour), now.Add(1*time.Hour))),
+				mustParse(t, newTestCert(t, nodeName, now.Add(-1*time.Hour), now.Add(48*time.Hour))),
+			},
+			expected: "my-node",
+		},
+		{
+			name: "all-expired",
+			certs: []*x509.Certificate{
+				mustParse(t, newTestCert(t, nodeName, now.Add(-48*time.Hour), now.Add(-1*time.Hour))),
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			name, err := nodeNameFromCerts("test-kubeconfig", tc.certs)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none (name: %q)", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != tc.expected {
+				t.Fatalf("expected node name %q, got %q", tc.expected, name)
+			}
+		})
+	}
+}
+
+func TestGetNodeNameFromKubeletConfigRotation(t *testing.T) {
+	now := time.Now()
+	nodeName := constants.NodesUserPrefix + "rotating-node"
+
+	oldDER := newTestCert(t, nodeName, now.Add(-48*time.Hour), now.Add(-1*time.Hour))
+	newDER := newTestCert(t, nodeName, now.Add(-1*time.Hour), now.Add(48*time.Hour))
+
+	tmpDir, err := ioutil.TempDir("", "kubeadm-cluster-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	t.Run("embedded-data PEM rotation", func(t *testing.T) {
+		kubeconfigPath := filepath.Join(tmpDir, "embedded.conf")
+		config := newTestKubeconfig(pemEncode(oldDER, newDER), "")
+		if err := clientcmd.WriteToFile(*config, kubeconfigPath); err != nil {
+			t.Fatalf("could not write kubeconfig: %v", err)
+		}
+
+		name, err := getNodeNameFromKubeletConfig(kubeconfigPath)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if name != "rotating-node" {
+			t.Fatalf("expected node name %q, got %q", "rotating-node", name)
+		}
+	})
+
+	t.Run("external-file PEM rotation", func(t *testing.T) {
+		certPath := filepath.Join(tmpDir, "kubelet-client.crt")
+		if err := ioutil.WriteFile(certPath, pemEncode(oldDER, newDER), 0600); err != nil {
+			t.Fatalf("could not write external cert file: %v", err)
+		}
+
+		kubeconfigPath := filepath.Join(tmpDir, "external.conf")
+		config := newTestKubeconfig(nil, certPath)
+		if err := clientcmd.WriteToFile(*config, kubeconfigPath); err != nil {
+			t.Fatalf("could not write kubeconfig: %v", err)
+		}
+
+		name, err := getNodeNameFromKubeletConfig(kubeconfigPath)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if name != "rotating-node" {
+			t.Fatalf("expected node name %q, got %q", "rotating-node", name)
+		}
+	})
+}
+
+// newTestKubeconfig builds a minimal, valid kubeconfig referencing either an embedded certificate blob or
+// an external certificate file.
+func newTestKubeconfig(certData []byte, certFile string) *clientcmdapi.Config {
+	const contextName = "test-context"
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters["test-cluster"] = clientcmdapi.NewCluster()
+	config.AuthInfos["test-user"] = clientcmdapi.NewAuthInfo()
+	config.AuthInfos["test-user"].ClientCertificateData = certData
+	config.AuthInfos["test-user"].ClientCertificate = certFile
+	config.Contexts[contextName] = clientcmdapi.NewContext()
+	config.Contexts[contextName].Cluster = "test-cluster"
+	config.Contexts[contextName].AuthInfo = "test-user"
+	config.CurrentContext = contextName
+
+	return config
+}
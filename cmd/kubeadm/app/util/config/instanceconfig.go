@@ -0,0 +1,71 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	kubeadmapiv1 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta3"
+	"k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+// NodeInstanceConfigFileName is the name of the kubeadm-owned file that records this node's identity.
+const NodeInstanceConfigFileName = "instance-config.yaml"
+
+// NodeInstanceConfigPath returns the canonical, absolute path of the node instance config file.
+func NodeInstanceConfigPath() string {
+	return filepath.Join(constants.KubeletRunDirectory, NodeInstanceConfigFileName)
+}
+
+// LoadNodeInstanceConfig reads and parses the node instance config file at path. It returns an
+// os.IsNotExist error unchanged so that callers can fall back to older ways of discovering node identity
+// on nodes that predate this file.
+func LoadNodeInstanceConfig(path string) (*kubeadmapiv1.NodeInstanceConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &kubeadmapiv1.NodeInstanceConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, errors.Wrapf(err, "could not parse node instance config %q", path)
+	}
+	if cfg.NodeName == "" {
+		return nil, errors.Errorf("node instance config %q is missing the nodeName field", path)
+	}
+	return cfg, nil
+}
+
+// WriteNodeInstanceConfig marshals cfg as YAML and writes it to path.
+func WriteNodeInstanceConfig(path string, cfg *kubeadmapiv1.NodeInstanceConfig) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal node instance config")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "could not create directory for %q", path)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return errors.Wrapf(err, "could not write node instance config %q", path)
+	}
+	return nil
+}
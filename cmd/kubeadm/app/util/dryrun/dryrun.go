@@ -0,0 +1,165 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dryrun contains utilities for phases that need to behave differently when kubeadm is invoked
+// with --dry-run: instead of writing to the real filesystem, they write through an AssetSink so that the
+// result can be inspected (and printed) without touching disk.
+package dryrun
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// FileToPrint represents a file that, in dry-run mode, should be printed to the user instead of written to
+// its real, final location.
+type FileToPrint struct {
+	// RealPath is where the file contents can currently be read from.
+	RealPath string
+	// PrintPath is the path the file will actually live at once kubeadm isn't dry-running.
+	PrintPath string
+}
+
+// NewFileToPrint is a helper function to create a FileToPrint instance.
+func NewFileToPrint(realPath, printPath string) FileToPrint {
+	return FileToPrint{RealPath: realPath, PrintPath: printPath}
+}
+
+// PrintDryRunFiles reads the real file backing each FileToPrint and writes its contents to w, labelled with
+// the path the file would have if kubeadm weren't dry-running.
+func PrintDryRunFiles(files []FileToPrint, w io.Writer) error {
+	for _, file := range files {
+		output, err := ioutil.ReadFile(file.RealPath)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't read file %q that was meant to be dry-run printed", file.RealPath)
+		}
+		fmt.Fprintf(w, "[dryrun] Wrote file %q with content:\n", file.PrintPath)
+		fmt.Fprintln(w, string(output))
+	}
+	return nil
+}
+
+// AssetSink is the destination phases write generated files to. DiskAssetSink writes them for real;
+// MemoryAssetSink keeps them in memory so that dry-run phases never touch the filesystem.
+type AssetSink interface {
+	// Write stores data at path with the given permissions.
+	Write(path string, data []byte, perm os.FileMode) error
+	// Files returns the written files that are left to print. DiskAssetSink returns none, since it wrote
+	// them for real; MemoryAssetSink returns them with an empty RealPath, so PrintAssetSink (not
+	// PrintDryRunFiles) is what prints their content.
+	Files() []FileToPrint
+}
+
+// DiskAssetSink is an AssetSink that writes files for real, rooted at baseDir.
+type DiskAssetSink struct {
+	baseDir string
+}
+
+// NewDiskAssetSink returns an AssetSink that writes files under baseDir.
+func NewDiskAssetSink(baseDir string) *DiskAssetSink {
+	return &DiskAssetSink{baseDir: baseDir}
+}
+
+// Write implements AssetSink.
+func (d *DiskAssetSink) Write(path string, data []byte, perm os.FileMode) error {
+	fullPath := filepath.Join(d.baseDir, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return errors.Wrapf(err, "couldn't create directory for %q", fullPath)
+	}
+	if err := ioutil.WriteFile(fullPath, data, perm); err != nil {
+		return errors.Wrapf(err, "couldn't write %q", fullPath)
+	}
+	return nil
+}
+
+// Files implements AssetSink. DiskAssetSink writes for real, so there is nothing left to print.
+func (d *DiskAssetSink) Files() []FileToPrint {
+	return nil
+}
+
+// memoryAsset is a single file held by a MemoryAssetSink.
+type memoryAsset struct {
+	data []byte
+	perm os.FileMode
+}
+
+// MemoryAssetSink is an AssetSink that keeps every written file in memory instead of on disk. printDir is
+// the directory the files would live under if they were actually written, and is only used for labelling
+// output when the contents are printed.
+type MemoryAssetSink struct {
+	printDir string
+	assets   map[string]memoryAsset
+}
+
+// NewMemoryAssetSink returns an AssetSink that keeps files in memory, reporting them as if they lived under
+// printDir.
+func NewMemoryAssetSink(printDir string) *MemoryAssetSink {
+	return &MemoryAssetSink{printDir: printDir, assets: map[string]memoryAsset{}}
+}
+
+// Write implements AssetSink.
+func (m *MemoryAssetSink) Write(path string, data []byte, perm os.FileMode) error {
+	m.assets[path] = memoryAsset{data: data, perm: perm}
+	return nil
+}
+
+// Files implements AssetSink. The returned FileToPrint.RealPath is empty, since the content never touched
+// disk; use Contents or PrintAssetSink to retrieve it.
+func (m *MemoryAssetSink) Files() []FileToPrint {
+	files := make([]FileToPrint, 0, len(m.assets))
+	for _, path := range m.sortedPaths() {
+		files = append(files, FileToPrint{PrintPath: filepath.Join(m.printDir, path)})
+	}
+	return files
+}
+
+// Contents returns the bytes written to path, if any.
+func (m *MemoryAssetSink) Contents(path string) ([]byte, bool) {
+	asset, ok := m.assets[path]
+	return asset.data, ok
+}
+
+func (m *MemoryAssetSink) sortedPaths() []string {
+	paths := make([]string, 0, len(m.assets))
+	for path := range m.assets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// PrintAssetSink prints every file recorded in sink to w. For a MemoryAssetSink the content is taken
+// straight from memory; for any other AssetSink it falls back to PrintDryRunFiles, reading the backing file
+// off disk.
+func PrintAssetSink(sink AssetSink, w io.Writer) error {
+	mem, ok := sink.(*MemoryAssetSink)
+	if !ok {
+		return PrintDryRunFiles(sink.Files(), w)
+	}
+
+	for _, path := range mem.sortedPaths() {
+		asset := mem.assets[path]
+		fmt.Fprintf(w, "[dryrun] Wrote file %q with content:\n", filepath.Join(mem.printDir, path))
+		fmt.Fprintln(w, string(asset.data))
+	}
+	return nil
+}